@@ -0,0 +1,47 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package derrors defines internal error values to categorize the different
+// error types encountered in the discovery site.
+package derrors
+
+import "errors"
+
+// Sentinel errors for use across the discovery codebase. Callers should
+// compare against these with errors.Is, since they may be wrapped with
+// additional context.
+var (
+	// NotFound indicates that a requested entity was not found (HTTP 404).
+	NotFound = errors.New("not found")
+
+	// InvalidArgument indicates that the input into the request is invalid
+	// in some way (HTTP 400).
+	InvalidArgument = errors.New("invalid argument")
+
+	// BadModule indicates a problem with a module such that it can never be
+	// processed (HTTP 490).
+	BadModule = errors.New("bad module")
+
+	// SumMismatch indicates that a downloaded module zip's computed hash did
+	// not match the hash recorded for it in a checksum database or local
+	// allowlist. Unlike a transient fetch error, this can't be resolved by
+	// retrying the download, so it is recorded with SumMismatchStatus and
+	// parked until an operator investigates.
+	SumMismatch = errors.New("checksum mismatch")
+)
+
+// Status codes recorded in version_state.status that have no HTTP meaning,
+// used to distinguish failure modes that originate inside the discovery
+// site rather than from the module proxy.
+const (
+	// BadModuleStatus is used when a module is structurally invalid, e.g.
+	// its zip fails dzip.CheckZip.
+	BadModuleStatus = 490
+
+	// SumMismatchStatus is used when a module zip fails checksum
+	// verification. It is treated like a 4xx status by the retry policy:
+	// retrying won't produce a different zip, so the version is parked
+	// rather than retried on the usual backoff schedule.
+	SumMismatchStatus = 491
+)
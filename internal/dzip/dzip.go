@@ -2,12 +2,23 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Package dzip provides helper functions for reading and validating module
+// zip files. CheckZip enforces the same restrictions that the go command
+// applies when it unpacks a module downloaded from a proxy, so that a
+// fetch can be rejected deterministically instead of failing partway
+// through (or exhausting memory) while unpacking it.
 package dzip
 
 import (
 	"archive/zip"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/module"
 )
 
 // MaxFileSize is the maximum filesize that is allowed for reading.
@@ -15,24 +26,216 @@ import (
 // this limit.
 //
 // It is mutable for testing purposes.
-var MaxFileSize = uint64(3e7)
+var MaxFileSize = int64(500 * 1024 * 1024)
+
+// MaxGoModSize and MaxLICENSESize are the maximum sizes allowed for a
+// module's go.mod and LICENSE files. These files are read into memory
+// before the rest of the zip is processed, so they are held to tighter
+// limits than MaxFileSize.
+//
+// They are mutable for testing purposes.
+var (
+	MaxGoModSize   = int64(16 * 1024 * 1024)
+	MaxLICENSESize = int64(16 * 1024 * 1024)
+)
+
+// MaxModuleZipSize is the maximum total uncompressed size of all the files
+// in a module zip. It guards against zip bombs: an archive that is small on
+// disk but expands to an unreasonable amount of data once unpacked.
+//
+// It is mutable for testing purposes.
+var MaxModuleZipSize = int64(2 * 1024 * 1024 * 1024)
+
+// CheckZip checks that r is a well-formed module zip for modulePath and
+// version, applying the same rules as golang.org/x/mod/zip.Check:
+//
+//   - every file must be named "<modulePath>@<version>/<suffix>", where
+//     suffix is a clean, relative path that does not contain ".." elements
+//     and is not absolute;
+//   - every path element must be a valid file name as accepted by
+//     module.CheckFilePath: no control characters or other disallowed
+//     characters, no reserved Windows device names, no trailing dot, and
+//     not made up only of dots (a leading dot, as in ".gitignore", is
+//     allowed);
+//   - no two files may have names that are equal under case-folding;
+//   - each file's uncompressed size must not exceed MaxFileSize (or the
+//     tighter MaxGoModSize/MaxLICENSESize limits for go.mod and LICENSE);
+//   - the sum of all files' uncompressed sizes must not exceed
+//     MaxModuleZipSize.
+//
+// CheckZip returns a descriptive error on the first violation it finds.
+func CheckZip(modulePath, version string, r *zip.Reader) error {
+	if err := module.Check(modulePath, version); err != nil {
+		return fmt.Errorf("dzip.CheckZip(%q, %q): %v", modulePath, version, err)
+	}
+	prefix := modulePath + "@" + version + "/"
+	seenLower := make(map[string]string) // lower-cased name -> original name
+	var totalSize int64
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return fmt.Errorf("dzip.CheckZip(%q, %q): file %q is not in module prefix %q", modulePath, version, f.Name, prefix)
+		}
+		suffix := strings.TrimSuffix(f.Name[len(prefix):], "/")
+		if suffix == "" {
+			// The prefix directory entry itself; skip it.
+			continue
+		}
+		if err := checkPath(suffix); err != nil {
+			return fmt.Errorf("dzip.CheckZip(%q, %q): %q: %v", modulePath, version, f.Name, err)
+		}
+		lower := strings.ToLower(f.Name)
+		if orig, ok := seenLower[lower]; ok {
+			return fmt.Errorf("dzip.CheckZip(%q, %q): case-insensitive file name collision: %q and %q", modulePath, version, orig, f.Name)
+		}
+		seenLower[lower] = f.Name
+
+		max := maxSizeFor(suffix)
+		size := int64(f.UncompressedSize64)
+		if size > max {
+			return fmt.Errorf("dzip.CheckZip(%q, %q): %q is %d bytes, exceeds maximum size %d", modulePath, version, f.Name, size, max)
+		}
+		totalSize += size
+		if totalSize > MaxModuleZipSize {
+			return fmt.Errorf("dzip.CheckZip(%q, %q): total uncompressed size exceeds maximum size %d", modulePath, version, MaxModuleZipSize)
+		}
+	}
+	return nil
+}
+
+// maxSizeFor returns the maximum uncompressed size allowed for a file whose
+// path (relative to the module prefix) is suffix: the tighter
+// MaxGoModSize/MaxLICENSESize limits for go.mod and LICENSE, and
+// MaxFileSize otherwise.
+func maxSizeFor(suffix string) int64 {
+	switch path.Base(suffix) {
+	case "go.mod":
+		return MaxGoModSize
+	case "LICENSE":
+		return MaxLICENSESize
+	default:
+		return MaxFileSize
+	}
+}
 
-// ReadZipFile decompresses zip file f and returns its uncompressed contents.
-// The caller can check f.UncompressedSize64 before calling ReadZipFile to
-// get the expected uncompressed size of f.
-func ReadZipFile(f *zip.File) ([]byte, error) {
+// checkPath reports whether suffix, the portion of a zip entry's name
+// following the "<module>@<version>/" prefix, is a clean relative path made
+// up of valid module file names, and returns an error describing the first
+// problem it finds.
+func checkPath(suffix string) error {
+	if path.Clean(suffix) != suffix {
+		return fmt.Errorf("file path is not clean")
+	}
+	if strings.HasPrefix(suffix, "/") {
+		return fmt.Errorf("file path is absolute")
+	}
+	for _, elem := range strings.Split(suffix, "/") {
+		if elem == ".." {
+			return fmt.Errorf("file path contains \"..\"")
+		}
+		if err := module.CheckFilePath(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadZipFile decompresses zip file f and returns its uncompressed
+// contents. It returns an error if the file's uncompressed size exceeds
+// maxSize, so that a single oversized entry cannot exhaust memory even if
+// it slipped past CheckZip (for example because MaxFileSize was lowered
+// between the two calls).
+func ReadZipFile(f *zip.File, maxSize int64) ([]byte, error) {
+	if size := int64(f.UncompressedSize64); size > maxSize {
+		return nil, fmt.Errorf("dzip.ReadZipFile(%q): file size %d exceeds maximum size %d", f.Name, size, maxSize)
+	}
 	r, err := f.Open()
 	if err != nil {
-		return nil, fmt.Errorf("f.Open() for %q: %v", f.Name, err)
+		return nil, fmt.Errorf("dzip.ReadZipFile(%q): f.Open(): %v", f.Name, err)
 	}
+	defer r.Close()
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
-		r.Close()
-		return nil, fmt.Errorf("ioutil.ReadAll(r) for %q: %v", f.Name, err)
-	}
-	err = r.Close()
-	if err != nil {
-		return nil, fmt.Errorf("r.Close() for %q: %v", f.Name, err)
+		return nil, fmt.Errorf("dzip.ReadZipFile(%q): ioutil.ReadAll(r): %v", f.Name, err)
 	}
 	return b, nil
-}
\ No newline at end of file
+}
+
+// Walk calls fn once for every regular file in the module zip r for
+// modulePath and version, in deterministic (sorted-by-path) order, so that
+// a walk over the same module zip always processes files in the same
+// sequence. Directory entries are skipped.
+//
+// Walk applies the same path and name validation as CheckZip before
+// opening any file, so a malformed entry is rejected without ever being
+// read. Each file is opened lazily — only when Walk reaches it, not
+// up front — and wrapped in an io.LimitReader capped at one byte past its
+// size limit (MaxFileSize, or the tighter MaxGoModSize/MaxLICENSESize for
+// go.mod and LICENSE), so a file whose declared size understates its
+// actual contents still fails fast instead of being read into memory in
+// full. Walk also tracks the running total of declared uncompressed sizes
+// and aborts, without opening any further files, once it would exceed
+// MaxModuleZipSize.
+//
+// fn is called with the file's path relative to the
+// "<modulePath>@<version>/" prefix. If fn returns an error, Walk stops and
+// returns an error whose message is fn's error prefixed with the module and
+// file name.
+func Walk(modulePath, version string, r *zip.Reader, fn func(pathInModule string, size int64, contents io.Reader) error) error {
+	if err := module.Check(modulePath, version); err != nil {
+		return fmt.Errorf("dzip.Walk(%q, %q): %v", modulePath, version, err)
+	}
+	prefix := modulePath + "@" + version + "/"
+	type entry struct {
+		f      *zip.File
+		suffix string
+	}
+	entries := make([]entry, 0, len(r.File))
+	seenLower := make(map[string]string) // lower-cased name -> original name
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return fmt.Errorf("dzip.Walk(%q, %q): file %q is not in module prefix %q", modulePath, version, f.Name, prefix)
+		}
+		suffix := strings.TrimSuffix(f.Name[len(prefix):], "/")
+		if suffix == "" {
+			continue
+		}
+		if err := checkPath(suffix); err != nil {
+			return fmt.Errorf("dzip.Walk(%q, %q): %q: %v", modulePath, version, f.Name, err)
+		}
+		lower := strings.ToLower(f.Name)
+		if orig, ok := seenLower[lower]; ok {
+			return fmt.Errorf("dzip.Walk(%q, %q): case-insensitive file name collision: %q and %q", modulePath, version, orig, f.Name)
+		}
+		seenLower[lower] = f.Name
+		entries = append(entries, entry{f, suffix})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].suffix < entries[j].suffix })
+
+	var totalSize int64
+	for _, e := range entries {
+		f, suffix := e.f, e.suffix
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		max := maxSizeFor(suffix)
+		size := int64(f.UncompressedSize64)
+		if size > max {
+			return fmt.Errorf("dzip.Walk(%q, %q): %q is %d bytes, exceeds maximum size %d", modulePath, version, f.Name, size, max)
+		}
+		totalSize += size
+		if totalSize > MaxModuleZipSize {
+			return fmt.Errorf("dzip.Walk(%q, %q): total uncompressed size exceeds maximum size %d", modulePath, version, MaxModuleZipSize)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("dzip.Walk(%q, %q): f.Open() for %q: %v", modulePath, version, f.Name, err)
+		}
+		err = fn(suffix, size, io.LimitReader(rc, max+1))
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("dzip.Walk(%q, %q): %q: %v", modulePath, version, f.Name, err)
+		}
+	}
+	return nil
+}
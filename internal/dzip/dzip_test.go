@@ -0,0 +1,201 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dzip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// buildZip builds a zip.Reader whose entries are exactly the given names
+// (relative to the zip root, so callers must include the
+// "<module>@<version>/" prefix themselves), each containing contents.
+func buildZip(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zw.Create(%q): %v", name, err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatalf("w.Write: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close(): %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	return zr
+}
+
+const testModule, testVersion = "foo.com/bar", "v1.0.0"
+
+func prefixed(name string) string {
+	return testModule + "@" + testVersion + "/" + name
+}
+
+func TestCheckZipValid(t *testing.T) {
+	zr := buildZip(t, map[string]string{
+		prefixed("go.mod"):   "module foo.com/bar\n",
+		prefixed("bar.go"):   "package bar\n",
+		prefixed("LICENSE"):  "MIT\n",
+		prefixed("sub/a.go"): "package sub\n",
+	})
+	if err := CheckZip(testModule, testVersion, zr); err != nil {
+		t.Errorf("CheckZip() = %v, want nil", err)
+	}
+}
+
+func TestCheckZipPathTraversal(t *testing.T) {
+	zr := buildZip(t, map[string]string{
+		prefixed("../../etc/passwd"): "pwned",
+	})
+	if err := CheckZip(testModule, testVersion, zr); err == nil {
+		t.Error("CheckZip() = nil, want error for \"..\" path traversal")
+	}
+}
+
+func TestCheckZipAbsolutePath(t *testing.T) {
+	zr := buildZip(t, map[string]string{
+		testModule + "@" + testVersion + "//etc/passwd": "pwned",
+	})
+	if err := CheckZip(testModule, testVersion, zr); err == nil {
+		t.Error("CheckZip() = nil, want error for absolute path")
+	}
+}
+
+func TestCheckZipCaseCollision(t *testing.T) {
+	zr := buildZip(t, map[string]string{
+		prefixed("a.go"): "package bar\n",
+		prefixed("A.go"): "package bar\n",
+	})
+	if err := CheckZip(testModule, testVersion, zr); err == nil {
+		t.Error("CheckZip() = nil, want error for case-insensitive name collision")
+	}
+}
+
+func TestCheckZipOversizedGoMod(t *testing.T) {
+	defer func(max int64) { MaxGoModSize = max }(MaxGoModSize)
+	MaxGoModSize = 4
+	zr := buildZip(t, map[string]string{
+		prefixed("go.mod"): "module foo.com/bar\n",
+	})
+	if err := CheckZip(testModule, testVersion, zr); err == nil {
+		t.Error("CheckZip() = nil, want error for oversized go.mod")
+	}
+}
+
+func TestCheckZipOversizedLICENSE(t *testing.T) {
+	defer func(max int64) { MaxLICENSESize = max }(MaxLICENSESize)
+	MaxLICENSESize = 2
+	zr := buildZip(t, map[string]string{
+		prefixed("LICENSE"): "MIT\n",
+	})
+	if err := CheckZip(testModule, testVersion, zr); err == nil {
+		t.Error("CheckZip() = nil, want error for oversized LICENSE")
+	}
+}
+
+func TestCheckZipTotalSizeLimit(t *testing.T) {
+	defer func(max int64) { MaxModuleZipSize = max }(MaxModuleZipSize)
+	MaxModuleZipSize = 4
+	zr := buildZip(t, map[string]string{
+		prefixed("a.go"): "package bar\n",
+		prefixed("b.go"): "package bar\n",
+	})
+	if err := CheckZip(testModule, testVersion, zr); err == nil {
+		t.Error("CheckZip() = nil, want error for total uncompressed size exceeding MaxModuleZipSize")
+	}
+}
+
+func TestWalkOrderAndContents(t *testing.T) {
+	zr := buildZip(t, map[string]string{
+		prefixed("z.go"):     "package bar // z\n",
+		prefixed("a.go"):     "package bar // a\n",
+		prefixed("sub/b.go"): "package sub // b\n",
+	})
+	var gotPaths []string
+	err := Walk(testModule, testVersion, zr, func(pathInModule string, size int64, contents io.Reader) error {
+		b, err := ioutil.ReadAll(contents)
+		if err != nil {
+			return err
+		}
+		if int64(len(b)) != size {
+			t.Errorf("len(contents for %q) = %d, want size %d", pathInModule, len(b), size)
+		}
+		gotPaths = append(gotPaths, pathInModule)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	wantPaths := []string{"a.go", "sub/b.go", "z.go"}
+	if len(gotPaths) != len(wantPaths) {
+		t.Fatalf("Walk visited %v, want %v", gotPaths, wantPaths)
+	}
+	for i, want := range wantPaths {
+		if gotPaths[i] != want {
+			t.Errorf("Walk visited paths %v, want %v", gotPaths, wantPaths)
+			break
+		}
+	}
+}
+
+func TestWalkRejectsMalformedEntryBeforeOpeningAny(t *testing.T) {
+	zr := buildZip(t, map[string]string{
+		prefixed("a.go"):             "package bar\n",
+		prefixed("../../etc/passwd"): "pwned",
+	})
+	var opened []string
+	err := Walk(testModule, testVersion, zr, func(pathInModule string, size int64, contents io.Reader) error {
+		opened = append(opened, pathInModule)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Walk() = nil, want error for \"..\" path traversal")
+	}
+	if len(opened) != 0 {
+		t.Errorf("Walk opened %v before rejecting the malformed entry, want none", opened)
+	}
+}
+
+func TestWalkTotalSizeLimit(t *testing.T) {
+	defer func(max int64) { MaxModuleZipSize = max }(MaxModuleZipSize)
+	MaxModuleZipSize = 4
+	zr := buildZip(t, map[string]string{
+		prefixed("a.go"): "package bar\n",
+		prefixed("b.go"): "package bar\n",
+	})
+	err := Walk(testModule, testVersion, zr, func(pathInModule string, size int64, contents io.Reader) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("Walk() = nil, want error for total uncompressed size exceeding MaxModuleZipSize")
+	}
+}
+
+func TestReadZipFile(t *testing.T) {
+	zr := buildZip(t, map[string]string{
+		prefixed("go.mod"): "module foo.com/bar\n",
+	})
+	b, err := ReadZipFile(zr.File[0], MaxGoModSize)
+	if err != nil {
+		t.Fatalf("ReadZipFile: %v", err)
+	}
+	if got, want := string(b), "module foo.com/bar\n"; got != want {
+		t.Errorf("ReadZipFile() = %q, want %q", got, want)
+	}
+	if _, err := ReadZipFile(zr.File[0], 1); err == nil {
+		t.Error("ReadZipFile() with maxSize=1 = nil, want error")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package internal defines types used by the rest of the discovery project.
+package internal
+
+import (
+	"strings"
+	"time"
+)
+
+// IndexVersion holds the information that the module index reports for
+// a given module version.
+type IndexVersion struct {
+	Path      string
+	Version   string
+	Timestamp time.Time
+
+	// HasGoMod reports whether this revision of the module has a go.mod
+	// file. It is false for versions that predate modules, which the go
+	// command instead exposes under a synthetic "+incompatible" version.
+	HasGoMod bool
+}
+
+// VersionState holds the process of fetching and processing a version of a
+// module.
+type VersionState struct {
+	ModulePath string
+	Version    string
+
+	// Incompatible reports whether Version carries the "+incompatible"
+	// build metadata suffix, which the Go tooling attaches to pre-modules
+	// v2+ tags that have no go.mod file. Incompatible versions are valid
+	// module versions, but are only selected when a module has no
+	// compatible (go.mod-bearing) version available.
+	Incompatible bool
+
+	IndexTimestamp time.Time
+	CreatedAt      time.Time
+
+	Status   *int
+	Error    *string
+	TryCount int
+
+	LastProcessedAt    *time.Time
+	NextProcessedAfter time.Time
+}
+
+// incompatibleSuffix is the build metadata suffix the go command appends to
+// versions that have no go.mod file at the revision they name.
+const incompatibleSuffix = "+incompatible"
+
+// IsIncompatible reports whether version carries the "+incompatible" build
+// metadata suffix.
+func IsIncompatible(version string) bool {
+	return strings.HasSuffix(version, incompatibleSuffix)
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package modcache implements an on-disk cache of downloaded module zips,
+// modeled on cmd/go/internal/modfetch's download cache. The fetch pipeline
+// consults the cache before downloading a module's zip from the proxy, and
+// populates it (after checksum verification) once a zip has been
+// downloaded.
+package modcache
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// Cache is an on-disk store of module zips, keyed by module path and
+// version. For each cached module it stores three files under Root:
+//
+//	<module>@<version>.zip       the module zip, as downloaded from the proxy
+//	<module>@<version>.ziphash   the zip's "h1:" hash (see Hash)
+//	<module>@<version>.info      the proxy's @v/<version>.info response
+type Cache struct {
+	// Root is the directory under which cached modules are stored. Module
+	// paths are escaped with module.EscapePath-style rules by the caller
+	// before being joined with Root, the same way the proxy URL space
+	// escapes them.
+	Root string
+}
+
+// New returns a Cache rooted at dir. dir is created if it does not exist.
+func New(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("modcache.New(%q): %v", dir, err)
+	}
+	return &Cache{Root: dir}, nil
+}
+
+func (c *Cache) path(modulePath, version, ext string) string {
+	return filepath.Join(c.Root, fmt.Sprintf("%s@%s.%s", filepath.FromSlash(modulePath), version, ext))
+}
+
+// Has reports whether modulePath at version is present in the cache.
+func (c *Cache) Has(modulePath, version string) bool {
+	_, err := os.Stat(c.path(modulePath, version, "zip"))
+	return err == nil
+}
+
+// Zip opens the cached zip for modulePath at version. Callers should check
+// Has first; Zip returns an error if the module is not cached.
+func (c *Cache) Zip(modulePath, version string) (*zip.ReadCloser, error) {
+	zr, err := zip.OpenReader(c.path(modulePath, version, "zip"))
+	if err != nil {
+		return nil, fmt.Errorf("modcache.Zip(%q, %q): %v", modulePath, version, err)
+	}
+	return zr, nil
+}
+
+// Hash reads the cached "h1:" hash for modulePath at version, previously
+// written by Put.
+func (c *Cache) Hash(modulePath, version string) (string, error) {
+	b, err := ioutil.ReadFile(c.path(modulePath, version, "ziphash"))
+	if err != nil {
+		return "", fmt.Errorf("modcache.Hash(%q, %q): %v", modulePath, version, err)
+	}
+	return string(b), nil
+}
+
+// Put stores zipData as the cached zip for modulePath at version, along
+// with infoData (the proxy's @v/<version>.info response) and the zip's
+// computed "h1:" hash, and returns the computed hash. Put does not verify
+// the hash; a caller that must verify it before the zip is persisted can
+// compute it first with HashZip.
+//
+// Put writes to temporary files and renames them into place, moving the
+// zip last, so a reader never observes a partially written cache entry:
+// once Has reports the module present, its .info and .ziphash files exist.
+func (c *Cache) Put(modulePath, version string, zipData, infoData []byte) (hash string, err error) {
+	hash, err = HashZip(modulePath, version, zipData)
+	if err != nil {
+		return "", fmt.Errorf("modcache.Put(%q, %q): %v", modulePath, version, err)
+	}
+	if err := c.writeFile(modulePath, version, "info", infoData); err != nil {
+		return "", err
+	}
+	if err := c.writeFile(modulePath, version, "ziphash", []byte(hash)); err != nil {
+		return "", err
+	}
+	if err := c.writeFile(modulePath, version, "zip", zipData); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (c *Cache) writeFile(modulePath, version, ext string, data []byte) error {
+	dst := c.path(modulePath, version, ext)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("modcache: creating directory for %s: %v", ext, err)
+	}
+	tmp := dst + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("modcache: writing %s: %v", ext, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("modcache: renaming %s into place: %v", ext, err)
+	}
+	return nil
+}
+
+// HashZip computes the "h1:" hash of a module zip's contents: the dirhash
+// algorithm the go command itself uses, namely the base64-standard
+// encoding of the SHA-256 digest of a manifest listing the SHA-256 of every
+// file in the zip, sorted by name, as "<sha256hex>  <module>@<version>/<path>\n".
+func HashZip(modulePath, version string, zipData []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		return "", fmt.Errorf("modcache.HashZip(%q, %q): %v", modulePath, version, err)
+	}
+	files := make([]string, len(zr.File))
+	byName := make(map[string]*zip.File, len(zr.File))
+	for i, f := range zr.File {
+		files[i] = f.Name
+		byName[f.Name] = f
+	}
+	sort.Strings(files)
+	open := func(name string) (io.ReadCloser, error) {
+		return byName[name].Open()
+	}
+	hash, err := dirhash.Hash1(files, open)
+	if err != nil {
+		return "", fmt.Errorf("modcache.HashZip(%q, %q): %v", modulePath, version, err)
+	}
+	return hash, nil
+}
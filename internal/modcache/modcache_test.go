@@ -0,0 +1,115 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modcache
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zw.Create(%q): %v", name, err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatalf("w.Write: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close(): %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestHashZipDeterministic(t *testing.T) {
+	files := map[string]string{
+		"foo.com/bar@v1.0.0/go.mod":  "module foo.com/bar\n",
+		"foo.com/bar@v1.0.0/bar.go":  "package bar\n",
+		"foo.com/bar@v1.0.0/LICENSE": "MIT\n",
+	}
+	h1, err := HashZip("foo.com/bar", "v1.0.0", testZip(t, files))
+	if err != nil {
+		t.Fatalf("HashZip: %v", err)
+	}
+	h2, err := HashZip("foo.com/bar", "v1.0.0", testZip(t, files))
+	if err != nil {
+		t.Fatalf("HashZip: %v", err)
+	}
+	if h1 != h2 {
+		t.Errorf("HashZip is not deterministic: %q != %q", h1, h2)
+	}
+	if h1[:3] != "h1:" {
+		t.Errorf("HashZip result %q does not start with h1: prefix", h1)
+	}
+}
+
+func TestCachePut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modcache-test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := New(dir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	const modulePath, version = "github.com/foo/bar", "v1.0.0"
+	zipData := testZip(t, map[string]string{
+		modulePath + "@" + version + "/go.mod": "module " + modulePath + "\n",
+	})
+	infoData := []byte(`{"Version":"v1.0.0"}`)
+
+	if c.Has(modulePath, version) {
+		t.Fatalf("Has(%q, %q) = true before Put", modulePath, version)
+	}
+	hash, err := c.Put(modulePath, version, zipData, infoData)
+	if err != nil {
+		t.Fatalf("Put(%q, %q): %v", modulePath, version, err)
+	}
+	if !c.Has(modulePath, version) {
+		t.Fatalf("Has(%q, %q) = false after Put", modulePath, version)
+	}
+	gotHash, err := c.Hash(modulePath, version)
+	if err != nil {
+		t.Fatalf("Hash(%q, %q): %v", modulePath, version, err)
+	}
+	if gotHash != hash {
+		t.Errorf("Hash(%q, %q) = %q, want %q", modulePath, version, gotHash, hash)
+	}
+	zr, err := c.Zip(modulePath, version)
+	if err != nil {
+		t.Fatalf("Zip(%q, %q): %v", modulePath, version, err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 1 {
+		t.Errorf("Zip(%q, %q) has %d files, want 1", modulePath, version, len(zr.File))
+	}
+}
+
+func TestParseAllowlist(t *testing.T) {
+	data := []byte(
+		"foo.com/bar v1.0.0 h1:abc=\n" +
+			"foo.com/bar v1.0.0/go.mod h1:def=\n" +
+			"\n",
+	)
+	al, err := ParseAllowlist(data)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	if got, want := al["foo.com/bar@v1.0.0"], "h1:abc="; got != want {
+		t.Errorf("al[%q] = %q, want %q", "foo.com/bar@v1.0.0", got, want)
+	}
+	if _, ok := al["foo.com/bar@v1.0.0/go.mod"]; ok {
+		t.Errorf("ParseAllowlist should not record go.mod pseudo-module lines")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modcache
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"golang.org/x/discovery/internal/derrors"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// Verifier checks a module zip's computed hash against a trusted source of
+// record before it is admitted to the cache.
+type Verifier interface {
+	// Verify returns nil if hash is the expected "h1:" hash for
+	// modulePath at version, and an error wrapping derrors.SumMismatch if
+	// the trusted source does not vouch for hash. An error that does not
+	// wrap derrors.SumMismatch means the source could not be consulted.
+	Verify(modulePath, version, hash string) error
+}
+
+// AllowlistVerifier verifies against a fixed, pre-populated set of hashes,
+// in the same "<module> <version> h1:<hash>" format as a go.sum file. It is
+// intended for operators who mirror a go.sum-style allowlist rather than
+// querying a checksum database over the network.
+type AllowlistVerifier map[string]string // "<module>@<version>" -> "h1:<hash>"
+
+// ParseAllowlist parses data in go.sum format into an AllowlistVerifier.
+// Lines naming a "/go.mod" pseudo-module (the go.sum convention for a
+// go.mod's own hash) are ignored, since the hash being verified (see
+// HashZip) covers the whole module zip rather than go.mod alone.
+func ParseAllowlist(data []byte) (AllowlistVerifier, error) {
+	al := AllowlistVerifier{}
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("modcache.ParseAllowlist: malformed line %q", line)
+		}
+		modulePath, version, hash := fields[0], fields[1], fields[2]
+		if strings.HasSuffix(version, "/go.mod") {
+			continue
+		}
+		al[modulePath+"@"+version] = hash
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("modcache.ParseAllowlist: %v", err)
+	}
+	return al, nil
+}
+
+// Verify implements Verifier.
+func (al AllowlistVerifier) Verify(modulePath, version, hash string) error {
+	want, ok := al[modulePath+"@"+version]
+	if !ok {
+		return fmt.Errorf("modcache: %s@%s not present in allowlist: %w", modulePath, version, derrors.SumMismatch)
+	}
+	if want != hash {
+		return fmt.Errorf("modcache: %s@%s: allowlist has %s, computed %s: %w", modulePath, version, want, hash, derrors.SumMismatch)
+	}
+	return nil
+}
+
+// SumDBVerifier verifies hashes against a remote checksum database using
+// the sum.golang.org "/lookup" protocol: a GET to
+// "<URL>/lookup/<module>@<version>" returns a note (see golang.org/x/mod/sumdb/note)
+// signed by the database's key, whose text is a list of lines
+// "<module> <version> h1:<hash>" and "<module> <version>/go.mod h1:<hash>".
+type SumDBVerifier struct {
+	// URL is the base URL of the checksum database, e.g.
+	// "https://sum.golang.org".
+	URL string
+	// VerifierKey is the database's public key, in the note.Verifier text
+	// format (e.g. "sum.golang.org+033de0ae+Ac4zctda...").
+	VerifierKey string
+	// HTTPClient is used to make requests; http.DefaultClient is used if
+	// nil.
+	HTTPClient *http.Client
+}
+
+// Verify implements Verifier by looking up modulePath and version in the
+// checksum database and comparing hash against the module line it returns.
+func (v SumDBVerifier) Verify(modulePath, version, hash string) error {
+	verifier, err := note.NewVerifier(v.VerifierKey)
+	if err != nil {
+		return fmt.Errorf("modcache.SumDBVerifier: %v", err)
+	}
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := fmt.Sprintf("%s/lookup/%s@%s", strings.TrimSuffix(v.URL, "/"), modulePath, version)
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("modcache.SumDBVerifier: GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("modcache.SumDBVerifier: GET %s: status %s", url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("modcache.SumDBVerifier: reading response from %s: %v", url, err)
+	}
+	msg, err := note.Open(body, note.VerifierList(verifier))
+	if err != nil {
+		return fmt.Errorf("modcache.SumDBVerifier: verifying signed note from %s: %v", url, err)
+	}
+	want := fmt.Sprintf("%s %s %s", modulePath, version, hash)
+	for _, line := range strings.Split(msg.Text, "\n") {
+		if line == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("modcache: %s@%s: hash %s not found in checksum database: %w", modulePath, version, hash, derrors.SumMismatch)
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package postgres provides a postgres implementation of the discovery
+// database.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DB wraps a postgres database connection.
+type DB struct {
+	db          *sql.DB
+	retryPolicy RetryPolicy
+}
+
+// New creates a new DB using conn, scheduling reprocessing of failed
+// fetches according to retryPolicy.
+func New(conn *sql.DB, retryPolicy RetryPolicy) *DB {
+	return &DB{db: conn, retryPolicy: retryPolicy}
+}
+
+// Transact executes fn in a transaction, rolling back if fn returns an
+// error and committing otherwise.
+func (db *DB) Transact(ctx context.Context, fn func(*sql.Tx) error) (err error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	return fn(tx)
+}
+
+// NowTruncated returns the current time truncated to microsecond precision,
+// which is what postgres' timestamp column stores. Tests that compare
+// timestamps round-tripped through the database should use this instead of
+// time.Now().
+func NowTruncated() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+)
+
+const testTimeout = 5 * time.Second
+
+var testDB *DB
+
+// TestMain connects to a scratch postgres instance (configured through the
+// standard libpq environment variables) that is reset between tests with
+// ResetTestDB. Tests in this package are skipped if the connection cannot
+// be established, so that `go test ./...` remains usable on a machine
+// without postgres installed.
+func TestMain(m *testing.M) {
+	conn, err := sql.Open("postgres", "")
+	if err != nil || conn.Ping() != nil {
+		os.Exit(0)
+	}
+	// Use a jitter-free retry policy so that scheduling assertions in tests
+	// are deterministic.
+	testRetryPolicy := DefaultRetryPolicy
+	testRetryPolicy.Jitter = 0
+	testDB = New(conn, testRetryPolicy)
+	os.Exit(m.Run())
+}
+
+// ResetTestDB truncates all tables in db, preparing it for the next test.
+func ResetTestDB(db *DB, t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := db.Transact(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `TRUNCATE version_state, index_versions CASCADE`)
+		return err
+	}); err != nil {
+		t.Fatalf("ResetTestDB: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how long version_state.next_processed_after is set
+// after a fetch attempt, based on how many times the version has already
+// been tried and how it failed.
+type RetryPolicy struct {
+	// BaseDelay is the backoff before the first retry after a failure, and
+	// the delay used after a successful fetch.
+	BaseDelay time.Duration
+	// MaxExponent caps the number of times BaseDelay is doubled, so the
+	// backoff plateaus instead of growing without bound.
+	MaxExponent int
+	// Jitter is the fraction (0-1) of the computed delay that is randomly
+	// added or subtracted, to keep retries from a batch of modules that
+	// failed together from all landing at once.
+	Jitter float64
+	// ParkDelay is the delay used after a 4xx response: the module itself
+	// is the problem, so there's little point retrying soon.
+	ParkDelay time.Duration
+
+	// randFloat64 returns a value in [0, 1). It is a field, rather than a
+	// direct call to rand.Float64, so tests can inject a deterministic
+	// source. A nil value is treated as always returning 0 (no jitter).
+	randFloat64 func() float64
+}
+
+// DefaultRetryPolicy is the backoff policy used in production: a 1 minute
+// base delay that doubles on every consecutive failure up to a 12-doubling
+// cap (~68 hours), ±10% jitter, and a 24 hour park delay for modules that
+// failed with a 4xx status.
+var DefaultRetryPolicy = RetryPolicy{
+	BaseDelay:   1 * time.Minute,
+	MaxExponent: 12,
+	Jitter:      0.1,
+	ParkDelay:   24 * time.Hour,
+	randFloat64: rand.Float64,
+}
+
+// next returns the time at which a version last tried at now, for the
+// tryCount'th time (1 for the first attempt), with the given HTTP status
+// code, should next be processed.
+//
+//   - 2xx clears the backoff: the next attempt (a re-check, not a retry) is
+//     scheduled after BaseDelay.
+//   - 4xx parks the version for ParkDelay, since retrying sooner won't make
+//     a bad module good.
+//   - Anything else (5xx, or a network error reported as status 0) backs
+//     off exponentially: BaseDelay * 2^min(tryCount-1, MaxExponent), ±Jitter.
+func (p RetryPolicy) next(now time.Time, tryCount, status int) time.Time {
+	switch {
+	case status >= 200 && status < 300:
+		return now.Add(p.BaseDelay)
+	case status >= 400 && status < 500:
+		return now.Add(p.ParkDelay)
+	default:
+		exponent := tryCount - 1
+		if exponent < 0 {
+			exponent = 0
+		}
+		if exponent > p.MaxExponent {
+			exponent = p.MaxExponent
+		}
+		delay := p.BaseDelay * time.Duration(int64(1)<<uint(exponent))
+		return now.Add(p.jitter(delay))
+	}
+}
+
+// jitter randomizes delay by up to ±p.Jitter.
+func (p RetryPolicy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return delay
+	}
+	r := 0.0
+	if p.randFloat64 != nil {
+		r = p.randFloat64()
+	}
+	factor := 1 + (2*r-1)*p.Jitter
+	return time.Duration(float64(delay) * factor)
+}
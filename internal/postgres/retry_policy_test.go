@@ -0,0 +1,70 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyNext(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := RetryPolicy{
+		BaseDelay:   1 * time.Minute,
+		MaxExponent: 3,
+		ParkDelay:   24 * time.Hour,
+	}
+
+	tests := []struct {
+		name      string
+		tryCount  int
+		status    int
+		wantDelay time.Duration
+	}{
+		{"success clears backoff", 1, 200, policy.BaseDelay},
+		{"success after retries clears backoff", 5, 204, policy.BaseDelay},
+		{"client error parks", 1, 404, policy.ParkDelay},
+		{"first failure", 1, 500, policy.BaseDelay},
+		{"second failure doubles", 2, 500, 2 * policy.BaseDelay},
+		{"third failure doubles again", 3, 500, 4 * policy.BaseDelay},
+		{"exponent caps at MaxExponent", 10, 500, 8 * policy.BaseDelay},
+		{"network error (status 0) backs off like 5xx", 2, 0, 2 * policy.BaseDelay},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := policy.next(now, test.tryCount, test.status)
+			want := now.Add(test.wantDelay)
+			if !got.Equal(want) {
+				t.Errorf("next(now, %d, %d) = %v, want %v", test.tryCount, test.status, got, want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := RetryPolicy{Jitter: 0.1}
+	delay := 100 * time.Minute
+
+	policy.randFloat64 = func() float64 { return 0.5 } // midpoint: no adjustment
+	if got := policy.jitter(delay); got != delay {
+		t.Errorf("jitter at midpoint randFloat64 = %v, want unchanged %v", got, delay)
+	}
+
+	policy.randFloat64 = func() float64 { return 1 } // maximum: +Jitter
+	if got, want := policy.jitter(delay), delay+delay/10; got != want {
+		t.Errorf("jitter at max randFloat64 = %v, want %v", got, want)
+	}
+
+	policy.randFloat64 = func() float64 { return 0 } // minimum: -Jitter
+	if got, want := policy.jitter(delay), delay-delay/10; got != want {
+		t.Errorf("jitter at min randFloat64 = %v, want %v", got, want)
+	}
+
+	policy.Jitter = 0
+	policy.randFloat64 = func() float64 { t.Fatal("randFloat64 called with Jitter <= 0"); return 0 }
+	if got := policy.jitter(delay); got != delay {
+		t.Errorf("jitter with Jitter=0 = %v, want unchanged %v", got, delay)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"golang.org/x/discovery/internal"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// LatestIndexTimestamp returns the last timestamp successfully recorded by
+// InsertIndexVersions. It returns the zero time if no versions have been
+// recorded yet.
+func (db *DB) LatestIndexTimestamp(ctx context.Context) (time.Time, error) {
+	var ts time.Time
+	row := db.db.QueryRowContext(ctx, `SELECT MAX(index_timestamp) FROM index_versions`)
+	if err := row.Scan(&ts); err != nil && err != sql.ErrNoRows {
+		return time.Time{}, fmt.Errorf("db.LatestIndexTimestamp(ctx): %v", err)
+	}
+	return ts, nil
+}
+
+// InsertIndexVersions inserts the versions reported by the module index,
+// storing the canonical form of each version (including, for versions that
+// have no go.mod file, the "+incompatible" suffix the go command adds)
+// along with the information needed to track them for fetching. Each
+// version is also seeded into version_state, so that a version that has
+// never been fetched is still picked up by GetNextVersionsToFetch; an
+// already-tracked version's fetch progress (status, try_count,
+// next_processed_after) is left untouched.
+func (db *DB) InsertIndexVersions(ctx context.Context, versions []*internal.IndexVersion) error {
+	return db.Transact(ctx, func(tx *sql.Tx) error {
+		for _, v := range versions {
+			version := v.Version
+			if cv := module.CanonicalVersion(version); cv != "" {
+				version = cv
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO index_versions (module_path, version, incompatible, has_go_mod, index_timestamp)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (module_path, version)
+				DO UPDATE SET index_timestamp=excluded.index_timestamp, has_go_mod=excluded.has_go_mod`,
+				v.Path, version, internal.IsIncompatible(version), v.HasGoMod, v.Timestamp); err != nil {
+				return fmt.Errorf("tx.ExecContext(ctx, ..., %q, %q, %s): %v", v.Path, v.Version, v.Timestamp, err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO version_state (module_path, version, incompatible, index_timestamp, created_at, try_count, next_processed_after)
+				VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, 0, CURRENT_TIMESTAMP)
+				ON CONFLICT (module_path, version)
+				DO UPDATE SET index_timestamp=excluded.index_timestamp, incompatible=excluded.incompatible`,
+				v.Path, version, internal.IsIncompatible(version), v.Timestamp); err != nil {
+				return fmt.Errorf("tx.ExecContext(ctx, ..., %q, %q, %s): %v", v.Path, v.Version, v.Timestamp, err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetNextVersionsToFetch returns the next versions that should be
+// processed: those whose NextProcessedAfter is not in the future, earliest
+// NextProcessedAfter first. Versions that are still backed off are not
+// returned.
+//
+// If latestOnly is true, at most one version is returned per module: the
+// highest compatible (non "+incompatible") version due for processing, or
+// if the module has no such version due, its highest +incompatible
+// version. This is used to prioritize getting a usable version of every
+// module fetched before spending requests on older or incompatible
+// versions of modules that already have one.
+func (db *DB) GetNextVersionsToFetch(ctx context.Context, limit int, latestOnly bool) ([]*internal.VersionState, error) {
+	query := `
+		SELECT module_path, version, incompatible, index_timestamp, created_at,
+			status, error, try_count, last_processed_at, next_processed_after
+		FROM version_state
+		WHERE next_processed_after <= CURRENT_TIMESTAMP
+		ORDER BY next_processed_after ASC, index_timestamp DESC`
+	var args []interface{}
+	if !latestOnly {
+		// When every due version is wanted, the database can apply the
+		// limit directly. In latestOnly mode, rows must be reduced to one
+		// per module before the limit is meaningful, so all due rows are
+		// fetched and the limit is applied in Go instead.
+		query += ` LIMIT $1`
+		args = append(args, limit)
+	}
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db.GetNextVersionsToFetch(ctx, %d, %t): %v", limit, latestOnly, err)
+	}
+	defer rows.Close()
+	states, err := scanVersionStates(rows)
+	if err != nil {
+		return nil, fmt.Errorf("db.GetNextVersionsToFetch(ctx, %d, %t): %v", limit, latestOnly, err)
+	}
+	if !latestOnly {
+		return states, nil
+	}
+	states = latestVersionStatePerModule(states)
+	if len(states) > limit {
+		states = states[:limit]
+	}
+	return states, nil
+}
+
+// latestVersionStatePerModule reduces states to at most one entry per
+// ModulePath, preferring the highest compatible version and falling back
+// to the highest +incompatible version if the module has none. The order
+// of the first VersionState seen for each module is preserved.
+func latestVersionStatePerModule(states []*internal.VersionState) []*internal.VersionState {
+	best := make(map[string]*internal.VersionState)
+	var modulePaths []string
+	for _, v := range states {
+		cur, ok := best[v.ModulePath]
+		if !ok {
+			modulePaths = append(modulePaths, v.ModulePath)
+			best[v.ModulePath] = v
+			continue
+		}
+		if betterVersionState(v, cur) {
+			best[v.ModulePath] = v
+		}
+	}
+	reduced := make([]*internal.VersionState, len(modulePaths))
+	for i, modulePath := range modulePaths {
+		reduced[i] = best[modulePath]
+	}
+	return reduced
+}
+
+// betterVersionState reports whether v should be preferred over cur as the
+// version to fetch next for a module: a compatible version always beats an
+// incompatible one, and within the same compatibility class the higher
+// semantic version wins.
+func betterVersionState(v, cur *internal.VersionState) bool {
+	if v.Incompatible != cur.Incompatible {
+		return !v.Incompatible
+	}
+	return semver.Compare(v.Version, cur.Version) > 0
+}
+
+// GetVersionState returns the current version state for modulePath and
+// version.
+func (db *DB) GetVersionState(ctx context.Context, modulePath, version string) (*internal.VersionState, error) {
+	row := db.db.QueryRowContext(ctx, `
+		SELECT module_path, version, incompatible, index_timestamp, created_at,
+			status, error, try_count, last_processed_at, next_processed_after
+		FROM version_state
+		WHERE module_path = $1 AND version = $2`, modulePath, version)
+	v := &internal.VersionState{}
+	var lastProcessedAt sql.NullTime
+	if err := row.Scan(&v.ModulePath, &v.Version, &v.Incompatible, &v.IndexTimestamp, &v.CreatedAt,
+		&v.Status, &v.Error, &v.TryCount, &lastProcessedAt, &v.NextProcessedAfter); err != nil {
+		return nil, fmt.Errorf("db.GetVersionState(ctx, %q, %q): %v", modulePath, version, err)
+	}
+	if lastProcessedAt.Valid {
+		v.LastProcessedAt = &lastProcessedAt.Time
+	}
+	return v, nil
+}
+
+// UpsertVersionState inserts or updates the row in version_state for
+// modulePath and version, recording the outcome of a fetch attempt and
+// rescheduling the version according to db.retryPolicy.
+func (db *DB) UpsertVersionState(ctx context.Context, modulePath, version string, indexTimestamp time.Time, status int, fetchErr error) error {
+	var errString *string
+	if fetchErr != nil {
+		s := fetchErr.Error()
+		errString = &s
+	}
+	now := NowTruncated()
+	return db.Transact(ctx, func(tx *sql.Tx) error {
+		var tryCount int
+		err := tx.QueryRowContext(ctx, `
+			SELECT try_count FROM version_state WHERE module_path = $1 AND version = $2 FOR UPDATE`,
+			modulePath, version).Scan(&tryCount)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("tx.QueryRowContext(ctx, ..., %q, %q): %v", modulePath, version, err)
+		}
+		tryCount++
+		nextProcessedAfter := db.retryPolicy.next(now, tryCount, status)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO version_state AS vs (
+				module_path, version, incompatible, index_timestamp, created_at,
+				status, error, try_count, last_processed_at, next_processed_after)
+			VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, $5, $6, 1, CURRENT_TIMESTAMP, $7)
+			ON CONFLICT (module_path, version)
+			DO UPDATE SET
+				status=excluded.status,
+				error=excluded.error,
+				try_count=vs.try_count + 1,
+				last_processed_at=excluded.last_processed_at,
+				next_processed_after=excluded.next_processed_after`,
+			modulePath, version, internal.IsIncompatible(version), indexTimestamp, status, errString, nextProcessedAfter); err != nil {
+			return fmt.Errorf("tx.ExecContext(ctx, ..., %q, %q, %d, %v): %v", modulePath, version, status, fetchErr, err)
+		}
+		return nil
+	})
+}
+
+// VersionStats holds statistics about the set of versions known to the
+// index.
+type VersionStats struct {
+	LatestTimestamp time.Time
+	// VersionCounts is a map of HTTP status code to the number of module
+	// versions that were last fetched with that status. Versions that have
+	// not been fetched yet are counted under status 0.
+	VersionCounts map[int]int
+	// KindCounts is a breakdown of all known versions by kind: "release",
+	// "prerelease", "pseudo", or "incompatible".
+	KindCounts map[string]int
+}
+
+// Version kinds reported in VersionStats.KindCounts.
+const (
+	KindRelease      = "release"
+	KindPrerelease   = "prerelease"
+	KindPseudo       = "pseudo"
+	KindIncompatible = "incompatible"
+)
+
+var pseudoVersionRE = regexp.MustCompile(`^v[0-9]+\.\d+\.\d+-(0\.)?\d{14}-[A-Za-z0-9]+(\+incompatible)?$`)
+
+// versionKind classifies version into one of the VersionStats.KindCounts
+// buckets. Incompatible takes precedence: an +incompatible pseudo-version
+// is counted as incompatible, since that is the more actionable signal for
+// operators triaging the index.
+func versionKind(version string) string {
+	switch {
+	case internal.IsIncompatible(version):
+		return KindIncompatible
+	case pseudoVersionRE.MatchString(version):
+		return KindPseudo
+	case isPrerelease(version):
+		return KindPrerelease
+	default:
+		return KindRelease
+	}
+}
+
+// isPrerelease reports whether version has a semantic versioning
+// pre-release component, e.g. "v1.2.3-beta.1".
+func isPrerelease(version string) bool {
+	for i := 0; i < len(version); i++ {
+		if version[i] == '-' {
+			return true
+		}
+		if version[i] == '+' {
+			break
+		}
+	}
+	return false
+}
+
+// GetVersionStats returns statistics about the modules in the index:
+// the timestamp of the most recently indexed version, a breakdown of the
+// last fetch status for every known version, and a breakdown of versions
+// by kind (release, prerelease, pseudo, or incompatible).
+func (db *DB) GetVersionStats(ctx context.Context) (*VersionStats, error) {
+	stats := &VersionStats{
+		VersionCounts: map[int]int{},
+		KindCounts:    map[string]int{},
+	}
+	row := db.db.QueryRowContext(ctx, `SELECT MAX(index_timestamp) FROM index_versions`)
+	if err := row.Scan(&stats.LatestTimestamp); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("db.GetVersionStats(ctx): %v", err)
+	}
+
+	rows, err := db.db.QueryContext(ctx, `SELECT status, version FROM version_state`)
+	if err != nil {
+		return nil, fmt.Errorf("db.GetVersionStats(ctx): %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			status  sql.NullInt64
+			version string
+		)
+		if err := rows.Scan(&status, &version); err != nil {
+			return nil, fmt.Errorf("db.GetVersionStats(ctx): rows.Scan: %v", err)
+		}
+		if status.Valid {
+			stats.VersionCounts[int(status.Int64)]++
+		} else {
+			stats.VersionCounts[0]++
+		}
+		stats.KindCounts[versionKind(version)]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db.GetVersionStats(ctx): %v", err)
+	}
+	return stats, nil
+}
+
+// scanVersionStates scans all rows of a version_state query into
+// internal.VersionState values.
+func scanVersionStates(rows *sql.Rows) ([]*internal.VersionState, error) {
+	var states []*internal.VersionState
+	for rows.Next() {
+		v := &internal.VersionState{}
+		var lastProcessedAt sql.NullTime
+		if err := rows.Scan(&v.ModulePath, &v.Version, &v.Incompatible, &v.IndexTimestamp, &v.CreatedAt,
+			&v.Status, &v.Error, &v.TryCount, &lastProcessedAt, &v.NextProcessedAfter); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %v", err)
+		}
+		if lastProcessedAt.Valid {
+			v.LastProcessedAt = &lastProcessedAt.Time
+		}
+		states = append(states, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
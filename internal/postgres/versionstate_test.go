@@ -55,10 +55,10 @@ func TestVersionState(t *testing.T) {
 		t.Fatalf("testDB.InsertIndexVersions(ctx, %v): %v", versions, err)
 	}
 
-	gotVersions, err := testDB.GetNextVersionsToFetch(ctx, 10)
+	gotVersions, err := testDB.GetNextVersionsToFetch(ctx, 10, false)
 	t.Logf("%+v", gotVersions)
 	if err != nil {
-		t.Fatalf("testDB.GetVersionsToFetch(ctx, 10): %v", err)
+		t.Fatalf("testDB.GetVersionsToFetch(ctx, 10, false): %v", err)
 	}
 
 	wantVersions := []*internal.VersionState{
@@ -106,8 +106,65 @@ func TestVersionState(t *testing.T) {
 			0:   1,
 			500: 1,
 		},
+		KindCounts: map[string]int{
+			KindRelease: 2,
+		},
 	}
 	if diff := cmp.Diff(wantStats, stats); diff != "" {
 		t.Errorf("testDB.GetVersionStats(ctx) mismatch (-want +got):\n%s", diff)
 	}
-}
\ No newline at end of file
+}
+
+func TestVersionKind(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v1.2.3", KindRelease},
+		{"v1.2.3-beta.1", KindPrerelease},
+		{"v0.0.0-20190101000000-abcdef123456", KindPseudo},
+		{"v1.2.3+incompatible", KindIncompatible},
+		{"v0.0.0-20190101000000-abcdef123456+incompatible", KindIncompatible},
+	}
+	for _, test := range tests {
+		if got := versionKind(test.version); got != test.want {
+			t.Errorf("versionKind(%q) = %q, want %q", test.version, got, test.want)
+		}
+	}
+}
+
+func TestGetNextVersionsToFetchLatestOnly(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// foo.com/bar has both a compatible version and a higher +incompatible
+	// one: the compatible version should be preferred.
+	// baz.com/quux has only +incompatible versions: the higher of the two
+	// should be returned.
+	versions := []*internal.IndexVersion{
+		{Path: "foo.com/bar", Version: "v1.0.0"},
+		{Path: "foo.com/bar", Version: "v2.0.0+incompatible"},
+		{Path: "baz.com/quux", Version: "v1.0.0+incompatible"},
+		{Path: "baz.com/quux", Version: "v2.0.0+incompatible"},
+	}
+	if err := testDB.InsertIndexVersions(ctx, versions); err != nil {
+		t.Fatalf("testDB.InsertIndexVersions(ctx, %v): %v", versions, err)
+	}
+
+	got, err := testDB.GetNextVersionsToFetch(ctx, 10, true)
+	if err != nil {
+		t.Fatalf("testDB.GetNextVersionsToFetch(ctx, 10, true): %v", err)
+	}
+	gotByModule := make(map[string]string)
+	for _, v := range got {
+		gotByModule[v.ModulePath] = v.Version
+	}
+	want := map[string]string{
+		"foo.com/bar":  "v1.0.0",
+		"baz.com/quux": "v2.0.0+incompatible",
+	}
+	if diff := cmp.Diff(want, gotByModule); diff != "" {
+		t.Errorf("testDB.GetNextVersionsToFetch(ctx, 10, true) mismatch (-want +got):\n%s", diff)
+	}
+}